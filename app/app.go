@@ -2,8 +2,10 @@ package app
 
 import (
 	"crypto/rand"
-	"encoding/base64"
+	"crypto/tls"
 	"errors"
+	"fmt"
+	"html"
 	"io/ioutil"
 	"log"
 	"math/big"
@@ -12,16 +14,20 @@ import (
 	"net/url"
 	"os"
 	"os/exec"
+	"os/signal"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"text/template"
+	"time"
 
 	"github.com/braintree/manners"
 	"github.com/elazarl/go-bindata-assetfs"
 	"github.com/fatih/camelcase"
 	"github.com/fatih/structs"
 	"github.com/gorilla/websocket"
-	"github.com/hashicorp/hcl"
 	"github.com/kr/pty"
 )
 
@@ -34,42 +40,85 @@ type App struct {
 
 	preferences   map[string]interface{}
 	titleTemplate *template.Template
+
+	clientsMutex sync.Mutex
+	clients      map[*clientContext]bool
+
+	bearerTokens *bearerTokenStore
 }
 
 type Options struct {
-	Address         string
-	Port            string
-	PermitWrite     bool
-	EnableBasicAuth bool
-	Credential      string
-	EnableRandomUrl bool
-	RandomUrlLength int
-	ProfileFile     string
-	EnableTLS       bool
-	TLSCrtFile      string
-	TLSKeyFile      string
-	TitleFormat     string
-	EnableReconnect bool
-	ReconnectTime   int
-	Once            bool
+	Address              string
+	Port                 string
+	PermitWrite          bool
+	EnableBasicAuth      bool
+	Credential           string
+	EnableRandomUrl      bool
+	RandomUrlLength      int
+	ProfileFile          string
+	EnableTLS            bool
+	TLSCrtFile           string
+	TLSKeyFile           string
+	TitleFormat          string
+	EnableReconnect      bool
+	ReconnectTime        int
+	Once                 bool
+	ReadTimeout          int
+	WriteTimeout         int
+	IdleTimeout          int
+	MaxHeaderBytes       int
+	ShutdownGrace        int
+	AllowedOrigins       []string
+	Commands             []CommandRoute
+	TrustedProxies       []string
+	BasePath             string
+	EnableBearerAuth     bool
+	BearerTokens         []string
+	BearerTokenFile      string
+	EnableClientCertAuth bool
+	ClientCAFile         string
+}
+
+// CommandRoute describes a single command mounted at its own URL path,
+// allowing one gotty process to expose several commands side by side.
+type CommandRoute struct {
+	Name        string
+	Path        string
+	Args        []string
+	PermitWrite bool
+	Credential  string
 }
 
 var DefaultOptions = Options{
-	Address:         "",
-	Port:            "8080",
-	PermitWrite:     false,
-	EnableBasicAuth: false,
-	Credential:      "",
-	EnableRandomUrl: false,
-	RandomUrlLength: 8,
-	ProfileFile:     "~/.gotty.prf",
-	EnableTLS:       false,
-	TLSCrtFile:      "~/.gotty.key",
-	TLSKeyFile:      "~/.gotty.crt",
-	TitleFormat:     "GoTTY - {{ .Command }} ({{ .Hostname }})",
-	EnableReconnect: false,
-	ReconnectTime:   10,
-	Once:            false,
+	Address:              "",
+	Port:                 "8080",
+	PermitWrite:          false,
+	EnableBasicAuth:      false,
+	Credential:           "",
+	EnableRandomUrl:      false,
+	RandomUrlLength:      8,
+	ProfileFile:          "~/.gotty.prf",
+	EnableTLS:            false,
+	TLSCrtFile:           "~/.gotty.key",
+	TLSKeyFile:           "~/.gotty.crt",
+	TitleFormat:          "GoTTY - {{ .Command }} ({{ .Hostname }})",
+	EnableReconnect:      false,
+	ReconnectTime:        10,
+	Once:                 false,
+	ReadTimeout:          0,
+	WriteTimeout:         0,
+	IdleTimeout:          0,
+	MaxHeaderBytes:       0,
+	ShutdownGrace:        0,
+	AllowedOrigins:       []string{},
+	Commands:             []CommandRoute{},
+	TrustedProxies:       []string{},
+	BasePath:             "",
+	EnableBearerAuth:     false,
+	BearerTokens:         []string{},
+	BearerTokenFile:      "",
+	EnableClientCertAuth: false,
+	ClientCAFile:         "",
 }
 
 func New(command []string, options *Options) (*App, error) {
@@ -83,18 +132,34 @@ func New(command []string, options *Options) (*App, error) {
 		return nil, err
 	}
 
+	upgrader := &websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		Subprotocols:    []string{"gotty"},
+	}
+	if len(options.AllowedOrigins) > 0 {
+		upgrader.CheckOrigin = func(r *http.Request) bool {
+			return isOriginAllowed(r.Header.Get("Origin"), options.AllowedOrigins)
+		}
+	}
+
+	var bearerTokens *bearerTokenStore
+	if options.EnableBearerAuth {
+		bearerTokens = newBearerTokenStore(options.BearerTokens, options.BearerTokenFile)
+	}
+
 	return &App{
 		command: command,
 		options: options,
 
-		upgrader: &websocket.Upgrader{
-			ReadBufferSize:  1024,
-			WriteBufferSize: 1024,
-			Subprotocols:    []string{"gotty"},
-		},
+		upgrader: upgrader,
 
 		preferences:   prefMap,
 		titleTemplate: titleTemplate,
+
+		clients: make(map[*clientContext]bool),
+
+		bearerTokens: bearerTokens,
 	}, nil
 }
 
@@ -119,7 +184,9 @@ func applyConfigFile(options *Options, filePath string) error {
 	}
 
 	config := make(map[string]interface{})
-	hcl.Decode(&config, string(fileString))
+	if err := configLoaderForPath(filePath).Decode(fileString, &config); err != nil {
+		return err
+	}
 	o := structs.New(options)
 	for _, name := range o.Names() {
 		configName := strings.ToLower(strings.Join(camelcase.Split(name), "_"))
@@ -128,10 +195,13 @@ func applyConfigFile(options *Options, filePath string) error {
 			if !ok {
 				return errors.New("No such field: " + name)
 			}
-			err := field.Set(val)
+			converted, err := coerceConfigValue(val, reflect.TypeOf(field.Value()))
 			if err != nil {
 				return err
 			}
+			if err := field.Set(converted); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -160,27 +230,101 @@ func loadProfileFile(options *Options) (map[string]interface{}, error) {
 		log.Printf("Loading profile path: %s", prefPath)
 		prefString, _ = ioutil.ReadFile(prefPath)
 	}
-	var prefMap map[string]interface{}
-	err := hcl.Decode(&prefMap, string(prefString))
+	prefMap := make(map[string]interface{})
+	err := configLoaderForPath(prefPath).Decode(prefString, &prefMap)
 	if err != nil {
 		return nil, err
 	}
 	return prefMap, nil
 }
 
+// buildSiteHandler wires up the ServeMux for routes, the multi-route index
+// page and the outer auth/CORS layers, and returns the resulting handler.
+// It is split out of Run so the mount wiring - in particular which paths end
+// up behind which credential - can be exercised directly in tests.
+//
+// Basic Auth is applied per route rather than once around the whole mux:
+// each route's static asset mount and its /ws handler share the same
+// authScheme, built from that route's own Credential override if it has
+// one, or from the global credential otherwise. Applying Basic Auth only
+// at the outer layer would mean a single route overriding its credential
+// strips auth from every other route's static assets, since the outer
+// layer has to be skipped entirely to let that route use its own scheme.
+func (app *App) buildSiteHandler(path string, routes []CommandRoute, staticHandler http.Handler) http.Handler {
+	var siteMux = http.NewServeMux()
+	for _, route := range routes {
+		route := route
+		mountPath := path + route.Path
+
+		var routeSchemes []authScheme
+		if route.Credential != "" {
+			log.Printf("Using Basic Authentication for route %q", route.Name)
+			routeSchemes = append(routeSchemes, basicAuthScheme{credential: route.Credential})
+		} else if app.options.EnableBasicAuth {
+			routeSchemes = append(routeSchemes, basicAuthScheme{credential: app.options.Credential})
+		}
+
+		routeStaticHandler := http.Handler(http.StripPrefix(mountPath+"/", staticHandler))
+		wsHandler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			app.handleWS(w, r, route)
+		}))
+		if len(routeSchemes) > 0 {
+			routeStaticHandler = wrapAuth(routeStaticHandler, routeSchemes)
+			wsHandler = wrapAuth(wsHandler, routeSchemes)
+		}
+		siteMux.Handle(mountPath+"/", routeStaticHandler)
+		siteMux.Handle(mountPath+"/ws", wsHandler)
+	}
+
+	if len(routes) > 1 {
+		indexHandler := http.Handler(http.HandlerFunc(app.handleIndex(routes, path)))
+		if app.options.EnableBasicAuth {
+			indexHandler = wrapAuth(indexHandler, []authScheme{basicAuthScheme{credential: app.options.Credential}})
+		}
+		siteMux.Handle(path+"/", indexHandler)
+	}
+
+	siteHandler := http.Handler(siteMux)
+
+	var schemes []authScheme
+	if app.options.EnableClientCertAuth {
+		log.Printf("Using Client Certificate Authentication")
+		schemes = append(schemes, clientCertAuthScheme{})
+	}
+	if app.options.EnableBearerAuth {
+		log.Printf("Using Bearer Token Authentication")
+		schemes = append(schemes, bearerAuthScheme{tokens: app.bearerTokens})
+	}
+	if len(schemes) > 0 {
+		siteHandler = wrapAuth(siteHandler, schemes)
+	}
+
+	// wrapCORS must sit outside (run before) auth so that a cross-origin
+	// preflight OPTIONS request - which carries no Authorization header -
+	// gets its 200/403 short-circuit before any auth scheme can 401 it.
+	if len(app.options.AllowedOrigins) > 0 {
+		log.Printf("Allowed Origins: %s", strings.Join(app.options.AllowedOrigins, ", "))
+		siteHandler = wrapCORS(siteHandler, app.options.AllowedOrigins)
+	}
+
+	return siteHandler
+}
+
 func (app *App) Run() error {
-	if app.options.PermitWrite {
-		log.Printf("Permitting clients to write input to the PTY.")
+	routes := app.resolveRoutes()
+	for _, route := range routes {
+		if route.PermitWrite {
+			log.Printf("Permitting clients to write input to the PTY on route %q.", route.Name)
+		}
 	}
 
-	path := ""
+	path := strings.TrimSuffix(app.options.BasePath, "/")
 	if app.options.EnableRandomUrl {
 		path += "/" + generateRandomString(app.options.RandomUrlLength)
 	}
 
 	endpoint := net.JoinHostPort(app.options.Address, app.options.Port)
 
-	wsHandler := http.HandlerFunc(app.handleWS)
 	staticHandler := http.FileServer(
 		&assetfs.AssetFS{Asset: Asset, AssetDir: AssetDir, Prefix: "static"},
 	)
@@ -189,18 +333,8 @@ func (app *App) Run() error {
 		log.Printf("Once option is provided, accepting only one client")
 	}
 
-	var siteMux = http.NewServeMux()
-	siteMux.Handle(path+"/", http.StripPrefix(path+"/", staticHandler))
-	siteMux.Handle(path+"/ws", wsHandler)
-
-	siteHandler := http.Handler(siteMux)
-
-	if app.options.EnableBasicAuth {
-		log.Printf("Using Basic Authentication")
-		siteHandler = wrapBasicAuth(siteHandler, app.options.Credential)
-	}
-
-	siteHandler = wrapLogger(siteHandler)
+	siteHandler := app.buildSiteHandler(path, routes, staticHandler)
+	siteHandler = wrapLogger(siteHandler, app.options.TrustedProxies)
 
 	scheme := "http"
 	if app.options.EnableTLS {
@@ -228,10 +362,43 @@ func (app *App) Run() error {
 		}
 	}
 
+	httpServer := &http.Server{
+		Addr:           endpoint,
+		Handler:        siteHandler,
+		ReadTimeout:    time.Duration(app.options.ReadTimeout) * time.Second,
+		WriteTimeout:   time.Duration(app.options.WriteTimeout) * time.Second,
+		IdleTimeout:    time.Duration(app.options.IdleTimeout) * time.Second,
+		MaxHeaderBytes: app.options.MaxHeaderBytes,
+	}
+	if app.options.EnableClientCertAuth {
+		if !app.options.EnableTLS {
+			return errors.New("EnableClientCertAuth requires EnableTLS")
+		}
+		log.Printf("Requiring a verified client certificate from: %s", app.options.ClientCAFile)
+		clientCAs, err := loadClientCAPool(app.options.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		httpServer.TLSConfig = &tls.Config{
+			ClientAuth: tls.RequireAndVerifyClientCert,
+			ClientCAs:  clientCAs,
+		}
+	}
+
 	var err error
-	app.server = manners.NewWithServer(
-		&http.Server{Addr: endpoint, Handler: siteHandler},
-	)
+	app.server = manners.NewWithServer(httpServer)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		log.Printf("Received signal, closing the listener and draining clients...")
+		app.server.Close()
+		if app.options.ShutdownGrace > 0 {
+			time.AfterFunc(time.Duration(app.options.ShutdownGrace)*time.Second, app.killDrainingClients)
+		}
+	}()
+
 	if app.options.EnableTLS {
 		err = app.server.ListenAndServeTLS(
 			expandHomeDir(app.options.TLSCrtFile),
@@ -249,8 +416,43 @@ func (app *App) Run() error {
 	return nil
 }
 
-func (app *App) handleWS(w http.ResponseWriter, r *http.Request) {
-	log.Printf("New client connected: %s", r.RemoteAddr)
+func (app *App) resolveRoutes() []CommandRoute {
+	if len(app.options.Commands) == 0 {
+		return []CommandRoute{
+			{
+				Name:        "",
+				Path:        "",
+				Args:        app.command,
+				PermitWrite: app.options.PermitWrite,
+			},
+		}
+	}
+	return app.options.Commands
+}
+
+func (app *App) handleIndex(routes []CommandRoute, path string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path+"/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, "<html><body><h1>GoTTY</h1><ul>")
+		for _, route := range routes {
+			name := route.Name
+			if name == "" {
+				name = strings.Join(route.Args, " ")
+			}
+			fmt.Fprintf(w, `<li><a href="%s%s/">%s</a></li>`, path, route.Path, html.EscapeString(name))
+		}
+		fmt.Fprint(w, "</ul></body></html>")
+	}
+}
+
+func (app *App) handleWS(w http.ResponseWriter, r *http.Request, route CommandRoute) {
+	clientAddr := resolveClientAddr(r.RemoteAddr, r.Header.Get("X-Forwarded-For"), app.options.TrustedProxies)
+	log.Printf("New client connected: %s", clientAddr)
 
 	if r.Method != "GET" {
 		http.Error(w, "Method not allowed", 405)
@@ -263,25 +465,58 @@ func (app *App) handleWS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cmd := exec.Command(app.command[0], app.command[1:]...)
+	cmd := exec.Command(route.Args[0], route.Args[1:]...)
 	ptyIo, err := pty.Start(cmd)
 	if err != nil {
 		log.Print("Failed to execute command")
 		return
 	}
-	log.Printf("Command is running for client %s with PID %d", r.RemoteAddr, cmd.Process.Pid)
+	log.Printf("Command is running for client %s with PID %d", clientAddr, cmd.Process.Pid)
 
 	context := &clientContext{
-		app:        app,
-		request:    r,
-		connection: conn,
-		command:    cmd,
-		pty:        ptyIo,
+		app:         app,
+		request:     r,
+		connection:  conn,
+		command:     cmd,
+		pty:         ptyIo,
+		permitWrite: route.PermitWrite,
 	}
 
+	app.registerClient(context)
+	defer app.deregisterClient(context)
+
 	context.goHandleClient()
 }
 
+func (app *App) registerClient(context *clientContext) {
+	app.clientsMutex.Lock()
+	defer app.clientsMutex.Unlock()
+	app.clients[context] = true
+}
+
+func (app *App) deregisterClient(context *clientContext) {
+	app.clientsMutex.Lock()
+	defer app.clientsMutex.Unlock()
+	delete(app.clients, context)
+}
+
+// killDrainingClients force-kills any PTY process still attached to a
+// client session once ShutdownGrace has elapsed after Close().
+func (app *App) killDrainingClients() {
+	app.clientsMutex.Lock()
+	defer app.clientsMutex.Unlock()
+
+	if len(app.clients) == 0 {
+		return
+	}
+	log.Printf("Shutdown grace period expired with %d client(s) still draining, killing their processes", len(app.clients))
+	for context := range app.clients {
+		if context.command.Process != nil {
+			context.command.Process.Kill()
+		}
+	}
+}
+
 func (app *App) Exit() (firstCall bool) {
 	if app.server != nil {
 		log.Printf("Received Exit command, waiting for all clients to close sessions...")
@@ -290,36 +525,44 @@ func (app *App) Exit() (firstCall bool) {
 	return true
 }
 
-func wrapLogger(handler http.Handler) http.Handler {
+func wrapLogger(handler http.Handler, trustedProxies []string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("%s %s", r.Method, r.URL.Path)
+		clientAddr := resolveClientAddr(r.RemoteAddr, r.Header.Get("X-Forwarded-For"), trustedProxies)
+		scheme := resolveScheme(r, trustedProxies)
+		log.Printf("%s://%s %s %s", scheme, clientAddr, r.Method, r.URL.Path)
 		handler.ServeHTTP(w, r)
 	})
 }
 
-func wrapBasicAuth(handler http.Handler, credential string) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
-
-		if len(token) != 2 || strings.ToLower(token[0]) != "basic" {
-			w.Header().Set("WWW-Authenticate", `Basic realm="GoTTY"`)
-			http.Error(w, "Bad Request", http.StatusUnauthorized)
-			return
+func isOriginAllowed(origin string, allowed []string) bool {
+	if origin == "" {
+		return true
+	}
+	for _, candidate := range allowed {
+		if candidate == "*" || candidate == origin {
+			return true
 		}
+	}
+	return false
+}
 
-		payload, err := base64.StdEncoding.DecodeString(token[1])
-		if err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
+func wrapCORS(handler http.Handler, allowed []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin != "" {
+			if !isOriginAllowed(origin, allowed) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 		}
 
-		if credential != string(payload) {
-			w.Header().Set("WWW-Authenticate", `Basic realm="GoTTY"`)
-			http.Error(w, "authorization failed", http.StatusUnauthorized)
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
 			return
 		}
 
-		log.Printf("Basic Authentication Succeeded: %s", r.RemoteAddr)
 		handler.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,195 @@
+package app
+
+import (
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// authScheme is one authentication requirement a request must satisfy.
+// Run composes the schemes selected by Options into a single chain, so
+// modes like client-cert + bearer token can be required together.
+type authScheme interface {
+	authenticate(r *http.Request) bool
+	// challenge returns the WWW-Authenticate header value to send when
+	// this scheme rejects a request, or "" if it has none.
+	challenge() string
+}
+
+// basicAuthScheme is the original (and still default) HTTP Basic
+// authentication mode, checked against a single shared credential.
+type basicAuthScheme struct {
+	credential string
+}
+
+func (s basicAuthScheme) authenticate(r *http.Request) bool {
+	token := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(token) != 2 || strings.ToLower(token[0]) != "basic" {
+		return false
+	}
+	payload, err := base64.StdEncoding.DecodeString(token[1])
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(s.credential), payload) == 1
+}
+
+func (s basicAuthScheme) challenge() string {
+	return `Basic realm="GoTTY"`
+}
+
+// bearerAuthScheme implements RFC 6750 Bearer token authentication
+// against a rotatable set of tokens (see bearerTokenStore).
+type bearerAuthScheme struct {
+	tokens *bearerTokenStore
+}
+
+func (s bearerAuthScheme) authenticate(r *http.Request) bool {
+	token := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(token) != 2 || strings.ToLower(token[0]) != "bearer" {
+		return false
+	}
+	return s.tokens.valid(token[1])
+}
+
+func (s bearerAuthScheme) challenge() string {
+	return `Bearer realm="GoTTY"`
+}
+
+// clientCertAuthScheme requires the connection to have completed a TLS
+// handshake with a verified client certificate. The requirement is
+// enforced by http.Server.TLSConfig, so there is no WWW-Authenticate
+// challenge to emit.
+type clientCertAuthScheme struct{}
+
+func (clientCertAuthScheme) authenticate(r *http.Request) bool {
+	return r.TLS != nil && len(r.TLS.VerifiedChains) > 0
+}
+
+func (clientCertAuthScheme) challenge() string {
+	return ""
+}
+
+// wrapAuth requires a request to satisfy every scheme in schemes before it
+// reaches handler.
+func wrapAuth(handler http.Handler, schemes []authScheme) http.Handler {
+	if len(schemes) == 0 {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, scheme := range schemes {
+			if scheme.authenticate(r) {
+				continue
+			}
+			if challenge := scheme.challenge(); challenge != "" {
+				w.Header().Add("WWW-Authenticate", challenge)
+			}
+			http.Error(w, "authorization failed", http.StatusUnauthorized)
+			return
+		}
+		log.Printf("Authentication succeeded: %s", r.RemoteAddr)
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// bearerTokenStore holds the set of valid bearer tokens. When backed by a
+// file it re-reads that file on SIGHUP, so tokens can be rotated without
+// restarting the server.
+type bearerTokenStore struct {
+	mu           sync.RWMutex
+	staticTokens []string
+	fileTokens   []string
+	tokens       map[string]bool
+	path         string
+}
+
+func newBearerTokenStore(tokens []string, path string) *bearerTokenStore {
+	store := &bearerTokenStore{staticTokens: tokens, path: path}
+	store.set(tokens)
+	if path != "" {
+		store.reload()
+		store.watchReload()
+	}
+	return store
+}
+
+// set replaces the token set used to authenticate requests, combining the
+// statically configured tokens with whatever fileTokens holds at the time.
+func (s *bearerTokenStore) set(fileTokens []string) {
+	s.mu.Lock()
+	s.fileTokens = fileTokens
+	m := make(map[string]bool, len(s.staticTokens)+len(fileTokens))
+	for _, token := range s.staticTokens {
+		if token != "" {
+			m[token] = true
+		}
+	}
+	for _, token := range fileTokens {
+		if token != "" {
+			m[token] = true
+		}
+	}
+	s.tokens = m
+	s.mu.Unlock()
+}
+
+func (s *bearerTokenStore) valid(token string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for known := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(known), []byte(token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *bearerTokenStore) reload() {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		log.Printf("Failed to reload bearer tokens from %s: %s", s.path, err)
+		return
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	tokens := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if token := strings.TrimSpace(line); token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	s.set(tokens)
+	log.Printf("Reloaded %d bearer token(s) from %s", len(tokens), s.path)
+}
+
+func (s *bearerTokenStore) watchReload() {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGHUP)
+	go func() {
+		for range sigChan {
+			s.reload()
+		}
+	}()
+}
+
+// loadClientCAPool reads a PEM file of client CA certificates, used to
+// configure http.Server.TLSConfig.ClientCAs for EnableClientCertAuth.
+func loadClientCAPool(path string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("no client CA certificates found in " + path)
+	}
+	return pool, nil
+}
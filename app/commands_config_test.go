@@ -0,0 +1,52 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyConfigFileDecodesCommandsFromJSON(t *testing.T) {
+	path := writeConfigFile(t, "gotty.json", `{
+		"commands": [
+			{"name": "shell", "path": "/shell", "args": ["/bin/bash"], "permit_write": true, "credential": "user:pass"},
+			{"name": "logs", "path": "/logs", "args": ["tail", "-f", "/var/log/syslog"]}
+		]
+	}`)
+
+	options := DefaultOptions
+	if err := applyConfigFile(&options, path); err != nil {
+		t.Fatalf("applyConfigFile failed: %s", err)
+	}
+
+	want := []CommandRoute{
+		{Name: "shell", Path: "/shell", Args: []string{"/bin/bash"}, PermitWrite: true, Credential: "user:pass"},
+		{Name: "logs", Path: "/logs", Args: []string{"tail", "-f", "/var/log/syslog"}},
+	}
+	if !reflect.DeepEqual(options.Commands, want) {
+		t.Errorf("unexpected Commands: got %#v, want %#v", options.Commands, want)
+	}
+}
+
+func TestApplyConfigFileDecodesCommandsFromYAML(t *testing.T) {
+	path := writeConfigFile(t, "gotty.yaml", `
+commands:
+  - name: shell
+    path: /shell
+    args:
+      - /bin/bash
+    permit_write: true
+    credential: "user:pass"
+`)
+
+	options := DefaultOptions
+	if err := applyConfigFile(&options, path); err != nil {
+		t.Fatalf("applyConfigFile failed: %s", err)
+	}
+
+	want := []CommandRoute{
+		{Name: "shell", Path: "/shell", Args: []string{"/bin/bash"}, PermitWrite: true, Credential: "user:pass"},
+	}
+	if !reflect.DeepEqual(options.Commands, want) {
+		t.Errorf("unexpected Commands: got %#v, want %#v", options.Commands, want)
+	}
+}
@@ -0,0 +1,181 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/camelcase"
+	"github.com/hashicorp/hcl"
+	"gopkg.in/yaml.v2"
+)
+
+// configLoader decodes the raw bytes of a config or profile file into a
+// generic map. applyConfigFile drives that map through the structs/camelcase
+// field mapping onto Options; loadProfileFile returns it as-is as the
+// client preferences.
+type configLoader interface {
+	Decode(data []byte, out *map[string]interface{}) error
+}
+
+// configLoaderForPath selects a configLoader based on the file extension,
+// defaulting to HCL for backward compatibility with existing configs.
+func configLoaderForPath(path string) configLoader {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return jsonConfigLoader{}
+	case ".yaml", ".yml":
+		return yamlConfigLoader{}
+	default:
+		return hclConfigLoader{}
+	}
+}
+
+type hclConfigLoader struct{}
+
+func (hclConfigLoader) Decode(data []byte, out *map[string]interface{}) error {
+	return hcl.Decode(out, string(data))
+}
+
+type jsonConfigLoader struct{}
+
+func (jsonConfigLoader) Decode(data []byte, out *map[string]interface{}) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+type yamlConfigLoader struct{}
+
+func (yamlConfigLoader) Decode(data []byte, out *map[string]interface{}) error {
+	if len(data) == 0 {
+		return nil
+	}
+	raw := make(map[interface{}]interface{})
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*out = stringifyYAMLMap(raw)
+	return nil
+}
+
+// stringifyYAMLMap converts the map[interface{}]interface{} produced by
+// yaml.v2 into the map[string]interface{} shape the rest of the config
+// pipeline (and structs/camelcase field mapping) expects.
+func stringifyYAMLMap(in map[interface{}]interface{}) map[string]interface{} {
+	out := make(map[string]interface{})
+	for k, v := range in {
+		out[fmt.Sprintf("%v", k)] = stringifyYAMLValue(v)
+	}
+	return out
+}
+
+func stringifyYAMLValue(in interface{}) interface{} {
+	switch v := in.(type) {
+	case map[interface{}]interface{}:
+		return stringifyYAMLMap(v)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = stringifyYAMLValue(e)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// coerceConfigValue converts a value decoded by a configLoader (JSON numbers
+// as float64, nested blocks/objects as []interface{} or []map[string]interface{},
+// etc.) into the concrete Go type of the Options field it's being assigned
+// to, so field.Set in applyConfigFile doesn't reject it on a type mismatch.
+func coerceConfigValue(val interface{}, target reflect.Type) (interface{}, error) {
+	if val == nil {
+		return reflect.Zero(target).Interface(), nil
+	}
+
+	if reflect.TypeOf(val).AssignableTo(target) {
+		return val, nil
+	}
+
+	switch target.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch v := val.(type) {
+		case float64:
+			return int(v), nil
+		case int:
+			return v, nil
+		case string:
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, err
+			}
+			return n, nil
+		}
+	case reflect.Bool:
+		if v, ok := val.(string); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, err
+			}
+			return b, nil
+		}
+	case reflect.Slice:
+		items, ok := toInterfaceSlice(val)
+		if !ok {
+			break
+		}
+		out := reflect.MakeSlice(target, len(items), len(items))
+		for i, item := range items {
+			converted, err := coerceConfigValue(item, target.Elem())
+			if err != nil {
+				return nil, err
+			}
+			out.Index(i).Set(reflect.ValueOf(converted))
+		}
+		return out.Interface(), nil
+	case reflect.Struct:
+		m, ok := val.(map[string]interface{})
+		if !ok {
+			break
+		}
+		out := reflect.New(target).Elem()
+		for i := 0; i < target.NumField(); i++ {
+			structField := target.Field(i)
+			configName := strings.ToLower(strings.Join(camelcase.Split(structField.Name), "_"))
+			raw, ok := m[configName]
+			if !ok {
+				continue
+			}
+			converted, err := coerceConfigValue(raw, structField.Type)
+			if err != nil {
+				return nil, err
+			}
+			out.Field(i).Set(reflect.ValueOf(converted))
+		}
+		return out.Interface(), nil
+	}
+
+	return nil, fmt.Errorf("cannot convert %T to %s", val, target)
+}
+
+// toInterfaceSlice normalizes the handful of generic slice shapes the
+// supported config formats can produce into a plain []interface{}.
+func toInterfaceSlice(val interface{}) ([]interface{}, bool) {
+	switch v := val.(type) {
+	case []interface{}:
+		return v, true
+	case []map[string]interface{}:
+		out := make([]interface{}, len(v))
+		for i, m := range v {
+			out[i] = m
+		}
+		return out, true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("failed to write config file: %s", err)
+	}
+	return path
+}
+
+func TestApplyConfigFileJSONCoercesTypes(t *testing.T) {
+	path := writeConfigFile(t, "gotty.json", `{
+		"read_timeout": 30,
+		"shutdown_grace": 5,
+		"enable_basic_auth": true,
+		"allowed_origins": ["https://example.com", "*"],
+		"trusted_proxies": ["10.0.0.0/8"]
+	}`)
+
+	options := DefaultOptions
+	if err := applyConfigFile(&options, path); err != nil {
+		t.Fatalf("applyConfigFile failed: %s", err)
+	}
+
+	if options.ReadTimeout != 30 {
+		t.Errorf("expected ReadTimeout 30, got %d", options.ReadTimeout)
+	}
+	if options.ShutdownGrace != 5 {
+		t.Errorf("expected ShutdownGrace 5, got %d", options.ShutdownGrace)
+	}
+	if !options.EnableBasicAuth {
+		t.Error("expected EnableBasicAuth true")
+	}
+	if !reflect.DeepEqual(options.AllowedOrigins, []string{"https://example.com", "*"}) {
+		t.Errorf("unexpected AllowedOrigins: %#v", options.AllowedOrigins)
+	}
+	if !reflect.DeepEqual(options.TrustedProxies, []string{"10.0.0.0/8"}) {
+		t.Errorf("unexpected TrustedProxies: %#v", options.TrustedProxies)
+	}
+}
+
+func TestApplyConfigFileYAMLCoercesTypes(t *testing.T) {
+	path := writeConfigFile(t, "gotty.yaml", `
+read_timeout: 45
+allowed_origins:
+  - https://example.com
+  - https://dashboard.example.com
+`)
+
+	options := DefaultOptions
+	if err := applyConfigFile(&options, path); err != nil {
+		t.Fatalf("applyConfigFile failed: %s", err)
+	}
+
+	if options.ReadTimeout != 45 {
+		t.Errorf("expected ReadTimeout 45, got %d", options.ReadTimeout)
+	}
+	if !reflect.DeepEqual(options.AllowedOrigins, []string{"https://example.com", "https://dashboard.example.com"}) {
+		t.Errorf("unexpected AllowedOrigins: %#v", options.AllowedOrigins)
+	}
+}
@@ -0,0 +1,57 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// buildAuthenticatedCORSHandler mirrors the middleware order Run wires up:
+// auth innermost, CORS outermost, so a preflight never reaches auth.
+func buildAuthenticatedCORSHandler(allowedOrigins []string, credential string) http.Handler {
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	handler := wrapAuth(inner, []authScheme{basicAuthScheme{credential: credential}})
+	return wrapCORS(handler, allowedOrigins)
+}
+
+func TestCORSPreflightBypassesAuth(t *testing.T) {
+	handler := buildAuthenticatedCORSHandler([]string{"https://dashboard.example.com"}, "user:pass")
+
+	req := httptest.NewRequest("OPTIONS", "/ws", nil)
+	req.Header.Set("Origin", "https://dashboard.example.com")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected allowed-origin preflight to short-circuit with 200, got %d", rec.Code)
+	}
+}
+
+func TestCORSPreflightRejectsDisallowedOrigin(t *testing.T) {
+	handler := buildAuthenticatedCORSHandler([]string{"https://dashboard.example.com"}, "user:pass")
+
+	req := httptest.NewRequest("OPTIONS", "/ws", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected disallowed-origin preflight to be rejected with 403, got %d", rec.Code)
+	}
+}
+
+func TestCORSAllowedOriginStillRequiresAuthForRealRequest(t *testing.T) {
+	handler := buildAuthenticatedCORSHandler([]string{"https://dashboard.example.com"}, "user:pass")
+
+	req := httptest.NewRequest("GET", "/ws", nil)
+	req.Header.Set("Origin", "https://dashboard.example.com")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected unauthenticated non-preflight request to be rejected with 401, got %d", rec.Code)
+	}
+}
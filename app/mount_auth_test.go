@@ -0,0 +1,99 @@
+package app
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func basicAuthHeader(credential string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(credential))
+}
+
+// TestBuildSiteHandlerPerRouteCredentialOverride exercises the real mount
+// wiring built by buildSiteHandler (the same code Run uses), rather than
+// wrapAuth/wrapCORS in isolation. One route overrides its credential while
+// another relies on the global one; the static asset mount of every route,
+// plus the multi-route index page, must stay behind the credential
+// appropriate to that route. The /ws mounts are not requested here.
+func TestBuildSiteHandlerPerRouteCredentialOverride(t *testing.T) {
+	options := DefaultOptions
+	options.EnableBasicAuth = true
+	options.Credential = "global:pass"
+	app := &App{options: &options}
+
+	routes := []CommandRoute{
+		{Name: "shell", Path: "/shell", Args: []string{"/bin/bash"}},
+		{Name: "logs", Path: "/logs", Args: []string{"tail"}, Credential: "logs:pass"},
+	}
+
+	staticHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	handler := app.buildSiteHandler("", routes, staticHandler)
+
+	cases := []struct {
+		name       string
+		path       string
+		credential string
+		wantStatus int
+	}{
+		{"default-route static with no credential", "/shell/", "", http.StatusUnauthorized},
+		{"default-route static with global credential", "/shell/", "global:pass", http.StatusOK},
+		{"default-route static rejects the other route's credential", "/shell/", "logs:pass", http.StatusUnauthorized},
+		{"override-route static with no credential", "/logs/", "", http.StatusUnauthorized},
+		{"override-route static with its own credential", "/logs/", "logs:pass", http.StatusOK},
+		{"override-route static rejects the global credential", "/logs/", "global:pass", http.StatusUnauthorized},
+		{"index page with no credential", "/", "", http.StatusUnauthorized},
+		{"index page with global credential", "/", "global:pass", http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.path, nil)
+			if tc.credential != "" {
+				req.Header.Set("Authorization", basicAuthHeader(tc.credential))
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tc.wantStatus {
+				t.Errorf("got status %d, want %d", rec.Code, tc.wantStatus)
+			}
+		})
+	}
+}
+
+// TestBuildSiteHandlerSingleRouteUsesGlobalCredential covers the common
+// single-route case: with no per-route override, the static mount at "/"
+// falls back to the global Basic Auth credential.
+func TestBuildSiteHandlerSingleRouteUsesGlobalCredential(t *testing.T) {
+	options := DefaultOptions
+	options.EnableBasicAuth = true
+	options.Credential = "global:pass"
+	app := &App{options: &options}
+
+	routes := []CommandRoute{{Name: "default", Path: "", Args: []string{"/bin/bash"}}}
+
+	staticHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	handler := app.buildSiteHandler("", routes, staticHandler)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected unauthenticated request to be rejected, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", basicAuthHeader("global:pass"))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected request with global credential to be allowed, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// isTrustedProxy reports whether ip matches one of the trusted CIDR ranges
+// or exact addresses configured via Options.TrustedProxies.
+func isTrustedProxy(ip string, trustedProxies []string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, candidate := range trustedProxies {
+		if strings.Contains(candidate, "/") {
+			if _, cidr, err := net.ParseCIDR(candidate); err == nil && cidr.Contains(addr) {
+				return true
+			}
+			continue
+		}
+		if candidateAddr := net.ParseIP(candidate); candidateAddr != nil && candidateAddr.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveClientAddr returns the real client address for a request, honoring
+// X-Forwarded-For only when the immediate peer (remoteAddr) is a trusted
+// proxy. It walks the forwarded chain from the right and returns the first
+// hop that is not itself a trusted proxy, so a spoofed header from an
+// untrusted peer can't be used to impersonate another address.
+func resolveClientAddr(remoteAddr, forwardedFor string, trustedProxies []string) string {
+	if forwardedFor == "" || len(trustedProxies) == 0 {
+		return remoteAddr
+	}
+
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	if !isTrustedProxy(host, trustedProxies) {
+		return remoteAddr
+	}
+
+	hops := strings.Split(forwardedFor, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" || isTrustedProxy(hop, trustedProxies) {
+			continue
+		}
+		return hop
+	}
+
+	return remoteAddr
+}
+
+// resolveScheme returns the scheme a request actually arrived over,
+// honoring X-Forwarded-Proto when the immediate peer is a trusted proxy.
+// The startup URL gotty logs in Run is printed once before any request
+// exists, so it can only ever reflect Options.EnableTLS; this is the
+// per-request equivalent, used by wrapLogger to log what scheme a given
+// client actually used once requests start arriving behind a proxy.
+func resolveScheme(r *http.Request, trustedProxies []string) string {
+	defaultScheme := "http"
+	if r.TLS != nil {
+		defaultScheme = "https"
+	}
+
+	proto := r.Header.Get("X-Forwarded-Proto")
+	if proto == "" || len(trustedProxies) == 0 {
+		return defaultScheme
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrustedProxy(host, trustedProxies) {
+		return defaultScheme
+	}
+
+	return strings.ToLower(strings.TrimSpace(proto))
+}
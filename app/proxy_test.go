@@ -0,0 +1,83 @@
+package app
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolveClientAddrNoTrustedProxies(t *testing.T) {
+	addr := resolveClientAddr("203.0.113.5:54321", "198.51.100.1", nil)
+	if addr != "203.0.113.5:54321" {
+		t.Errorf("expected raw remote addr when no proxies are trusted, got %q", addr)
+	}
+}
+
+func TestResolveClientAddrUntrustedPeerSpoofing(t *testing.T) {
+	trusted := []string{"10.0.0.0/8"}
+
+	// The peer itself (203.0.113.5) is not a trusted proxy, so any
+	// X-Forwarded-For header it sends must be ignored rather than trusted.
+	addr := resolveClientAddr("203.0.113.5:54321", "1.2.3.4", trusted)
+	if addr != "203.0.113.5:54321" {
+		t.Errorf("expected spoofed X-Forwarded-For from untrusted peer to be ignored, got %q", addr)
+	}
+}
+
+func TestResolveClientAddrTrustedProxyChain(t *testing.T) {
+	trusted := []string{"10.0.0.0/8"}
+
+	addr := resolveClientAddr("10.0.0.1:443", "203.0.113.9, 10.0.0.2", trusted)
+	if addr != "203.0.113.9" {
+		t.Errorf("expected rightmost untrusted hop, got %q", addr)
+	}
+}
+
+func TestResolveClientAddrAllHopsTrusted(t *testing.T) {
+	trusted := []string{"10.0.0.0/8"}
+
+	addr := resolveClientAddr("10.0.0.1:443", "10.0.0.3, 10.0.0.2", trusted)
+	if addr != "10.0.0.1:443" {
+		t.Errorf("expected fallback to remote addr when every hop is trusted, got %q", addr)
+	}
+}
+
+func TestIsTrustedProxyExactMatch(t *testing.T) {
+	if !isTrustedProxy("198.51.100.7", []string{"198.51.100.7"}) {
+		t.Error("expected exact address match to be trusted")
+	}
+	if isTrustedProxy("198.51.100.8", []string{"198.51.100.7"}) {
+		t.Error("expected non-matching address to be untrusted")
+	}
+}
+
+func TestResolveSchemeDefaultsToHTTP(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "203.0.113.5:54321"
+	req.Header.Set("X-Forwarded-Proto", "https")
+
+	if scheme := resolveScheme(req, nil); scheme != "http" {
+		t.Errorf("expected http when no proxies are trusted, got %q", scheme)
+	}
+}
+
+func TestResolveSchemeHonorsForwardedProtoFromTrustedProxy(t *testing.T) {
+	trusted := []string{"10.0.0.0/8"}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:443"
+	req.Header.Set("X-Forwarded-Proto", "https")
+
+	if scheme := resolveScheme(req, trusted); scheme != "https" {
+		t.Errorf("expected https from trusted proxy's X-Forwarded-Proto, got %q", scheme)
+	}
+}
+
+func TestResolveSchemeIgnoresForwardedProtoFromUntrustedPeer(t *testing.T) {
+	trusted := []string{"10.0.0.0/8"}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "203.0.113.5:54321"
+	req.Header.Set("X-Forwarded-Proto", "https")
+
+	if scheme := resolveScheme(req, trusted); scheme != "http" {
+		t.Errorf("expected spoofed X-Forwarded-Proto from untrusted peer to be ignored, got %q", scheme)
+	}
+}